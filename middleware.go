@@ -0,0 +1,188 @@
+package goshopify
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	shopifyTopicHeader      = "X-Shopify-Topic"
+	shopifyShopDomainHeader = "X-Shopify-Shop-Domain"
+	shopifyWebhookIDHeader  = "X-Shopify-Webhook-Id"
+	shopifyAPIVersionHeader = "X-Shopify-API-Version"
+	appProxyTimestampParam  = "timestamp"
+)
+
+// DefaultReplayWindow is a reasonable replay window to pass to
+// WithReplayWindow for apps that want one but don't need a custom value.
+const DefaultReplayWindow = 30 * time.Second
+
+// WebhookInfo is parsed from a verified webhook request and stashed in the
+// request context so handlers don't need to re-read headers or the body.
+type WebhookInfo struct {
+	Topic      string
+	ShopDomain string
+	WebhookID  string
+	APIVersion string
+	// ReceivedAt is when this middleware received the request. Shopify
+	// webhook deliveries do not carry a signed send time, so this is not a
+	// trustworthy measure of when Shopify triggered the event.
+	ReceivedAt time.Time
+	// Body is the raw request body that was verified.
+	Body []byte
+}
+
+type contextKey string
+
+const webhookInfoContextKey contextKey = "goshopify.webhookInfo"
+
+// WebhookInfoFromContext returns the WebhookInfo stashed by WebhookMiddleware,
+// if any.
+func WebhookInfoFromContext(ctx context.Context) (WebhookInfo, bool) {
+	info, ok := ctx.Value(webhookInfoContextKey).(WebhookInfo)
+	return info, ok
+}
+
+// MiddlewareOption configures WebhookMiddleware and AppProxyMiddleware.
+type MiddlewareOption func(*middlewareConfig)
+
+type middlewareConfig struct {
+	replayWindow time.Duration
+	seenID       func(id string) bool
+}
+
+// WithReplayWindow rejects requests older than the given duration. It is
+// opt-in: the check is disabled by default (as if a zero or negative
+// duration were given), since app proxy requests are real-time browser page
+// loads and rejecting them over ordinary clock skew would be a behavior
+// change nobody asked for. Pass DefaultReplayWindow for Shopify's typical
+// tolerance, or a duration of your own choosing.
+//
+// Shopify webhook deliveries carry no signed send time, so WebhookMiddleware
+// cannot enforce this option and ignores it. AppProxyMiddleware can enforce
+// it because app proxy requests include a "timestamp" query parameter that
+// is itself covered by the request signature.
+func WithReplayWindow(d time.Duration) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.replayWindow = d
+	}
+}
+
+// WithIdempotencyCheck registers a callback used to detect retried
+// deliveries. For WebhookMiddleware, seen is called with the
+// X-Shopify-Webhook-Id header; for AppProxyMiddleware, it is called with the
+// request's signature query parameter. If it returns true, the request is
+// acknowledged with 200 and the wrapped handler is skipped rather than
+// re-run, so Shopify does not treat the duplicate delivery as a failure and
+// retry it. Callers are expected to record ids they have already processed.
+func WithIdempotencyCheck(seen func(id string) bool) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.seenID = seen
+	}
+}
+
+func newMiddlewareConfig(opts ...MiddlewareOption) middlewareConfig {
+	var cfg middlewareConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WebhookMiddleware verifies the X-Shopify-Hmac-Sha256 header on incoming
+// webhook requests, rejecting unverified requests with 401 before the
+// wrapped handler runs. On success it stashes a WebhookInfo in the request
+// context, retrievable with WebhookInfoFromContext.
+func WebhookMiddleware(app App, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := newMiddlewareConfig(opts...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, err := app.VerifyWebhookRequestVerbose(r)
+			if !ok {
+				http.Error(w, "webhook verification failed: "+errString(err), http.StatusUnauthorized)
+				return
+			}
+
+			// VerifyWebhookRequestVerbose already drained and restored
+			// r.Body; read it once more so it can be stashed in
+			// WebhookInfo, then restore it again for the wrapped handler.
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "reading webhook body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+			webhookID := r.Header.Get(shopifyWebhookIDHeader)
+			if cfg.seenID != nil && cfg.seenID(webhookID) {
+				// A verified duplicate delivery is not an auth failure;
+				// ack it so Shopify stops retrying instead of treating the
+				// skip as a failed delivery.
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			info := WebhookInfo{
+				Topic:      r.Header.Get(shopifyTopicHeader),
+				ShopDomain: r.Header.Get(shopifyShopDomainHeader),
+				WebhookID:  webhookID,
+				APIVersion: r.Header.Get(shopifyAPIVersionHeader),
+				ReceivedAt: time.Now().UTC(),
+				Body:       body,
+			}
+
+			ctx := context.WithValue(r.Context(), webhookInfoContextKey, info)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// AppProxyMiddleware verifies the signature query parameter on incoming app
+// proxy requests, rejecting unverified requests with 401 before the wrapped
+// handler runs. WithReplayWindow and WithIdempotencyCheck are honored using
+// the request's timestamp and signature query parameters.
+func AppProxyMiddleware(app App, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := newMiddlewareConfig(opts...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.VerifySignature(r.URL) {
+				http.Error(w, "app proxy signature verification failed", http.StatusUnauthorized)
+				return
+			}
+
+			query := r.URL.Query()
+
+			if cfg.replayWindow > 0 {
+				ts, err := strconv.ParseInt(query.Get(appProxyTimestampParam), 10, 64)
+				if err != nil {
+					http.Error(w, "app proxy request is missing a valid timestamp", http.StatusUnauthorized)
+					return
+				}
+				if age := time.Since(time.Unix(ts, 0)); age > cfg.replayWindow {
+					http.Error(w, "app proxy request too old", http.StatusUnauthorized)
+					return
+				}
+			}
+
+			if cfg.seenID != nil && cfg.seenID(query.Get("signature")) {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return "unknown error"
+	}
+	return err.Error()
+}
@@ -163,15 +163,22 @@ func (app App) VerifySignature(u *url.URL) bool {
 	sig := val.Get("signature")
 	val.Del("signature")
 
+	return hmacSHA256([]byte(app.ApiSecret), []byte(EncodeProxyParams(val)), []byte(sig))
+}
+
+// EncodeProxyParams reproduces Shopify's app proxy signing scheme: each
+// key/value pair is joined as "key=value1,value2", the pairs are sorted and
+// concatenated with no separator. It is exported so that SignProxyURL and
+// other callers signing outbound requests to partner services can reuse the
+// exact encoding VerifySignature checks incoming requests against.
+func EncodeProxyParams(params url.Values) string {
 	keys := []string{}
-	for k, v := range val {
+	for k, v := range params {
 		keys = append(keys, fmt.Sprintf("%s=%s", k, strings.Join(v, ",")))
 	}
 	sort.Strings(keys)
 
-	joined := strings.Join(keys, "")
-
-	return hmacSHA256([]byte(app.ApiSecret), []byte(joined), []byte(sig))
+	return strings.Join(keys, "")
 }
 
 func hmacSHA256(key, body, expected []byte) bool {
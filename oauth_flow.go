@@ -0,0 +1,243 @@
+package goshopify
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var shopDomainPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9\-]*\.myshopify\.com$`)
+
+// StateStore persists the OAuth state parameter generated by OAuthFlow.Begin
+// so OAuthFlow.Complete can confirm the callback belongs to the request that
+// started it, preventing CSRF.
+type StateStore interface {
+	// Put records state for the in-flight OAuth request described by r,
+	// using w to set a cookie or header if needed.
+	Put(w http.ResponseWriter, r *http.Request, state string) error
+	// Verify reports whether state matches what was recorded for r. A state
+	// must only verify once; implementations should invalidate it after a
+	// successful check, using w to clear a cookie or equivalent if needed.
+	Verify(w http.ResponseWriter, r *http.Request, state string) (bool, error)
+}
+
+// OAuthFlow wraps App's low level verification primitives into a safe
+// end-to-end OAuth implementation: it generates and stores the state
+// parameter, validates the callback's HMAC, state and shop domain, and
+// exchanges the authorization code for a Token.
+type OAuthFlow struct {
+	app   App
+	store StateStore
+}
+
+// NewOAuthFlow builds an OAuthFlow for app, persisting state with store. Use
+// NewMemoryStateStore for a single-process server, or NewCookieStateStore
+// for a stateless server running behind a load balancer.
+func NewOAuthFlow(app App, store StateStore) *OAuthFlow {
+	return &OAuthFlow{app: app, store: store}
+}
+
+// Begin starts the OAuth flow for shop: it generates a random state, records
+// it via the configured StateStore, and returns the Shopify authorization
+// URL the caller should redirect the user to.
+func (f *OAuthFlow) Begin(w http.ResponseWriter, r *http.Request, shop string) (string, error) {
+	if !shopDomainPattern.MatchString(shop) {
+		return "", fmt.Errorf("invalid shop domain: %s", shop)
+	}
+
+	state, err := generateState()
+	if err != nil {
+		return "", err
+	}
+
+	if err := f.store.Put(w, r, state); err != nil {
+		return "", err
+	}
+
+	return f.app.AuthorizeUrl(shop, state), nil
+}
+
+// Complete validates a Shopify OAuth callback request: it checks the hmac
+// parameter, confirms the state parameter matches the one stored by Begin,
+// confirms the shop parameter is a well-formed myshopify.com domain, and
+// exchanges the authorization code for an access token. w is used to clear
+// the state record (e.g. the state cookie set by Begin) once it has been
+// consumed.
+func (f *OAuthFlow) Complete(w http.ResponseWriter, r *http.Request) (*Token, string, error) {
+	ok, err := f.app.VerifyAuthorizationURL(r.URL)
+	if err != nil {
+		return nil, "", err
+	}
+	if !ok {
+		return nil, "", errors.New("hmac verification failed")
+	}
+
+	query := r.URL.Query()
+
+	shop := query.Get("shop")
+	if !shopDomainPattern.MatchString(shop) {
+		return nil, "", fmt.Errorf("invalid shop domain: %s", shop)
+	}
+
+	state := query.Get("state")
+	if state == "" {
+		return nil, "", errors.New("state parameter is missing")
+	}
+
+	ok, err = f.store.Verify(w, r, state)
+	if err != nil {
+		return nil, "", err
+	}
+	if !ok {
+		return nil, "", errors.New("state verification failed")
+	}
+
+	token, err := f.app.GetAccessToken(shop, query.Get("code"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return token, shop, nil
+}
+
+func generateState() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// MemoryStateStore is the default StateStore: it keeps outstanding states in
+// memory until they are verified or expire. It is suitable for a
+// single-process server; use CookieStateStore for a server farm.
+type MemoryStateStore struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	states map[string]time.Time
+}
+
+// NewMemoryStateStore builds a MemoryStateStore whose entries expire after
+// ttl. A ttl of 0 defaults to 10 minutes.
+func NewMemoryStateStore(ttl time.Duration) *MemoryStateStore {
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+	return &MemoryStateStore{
+		ttl:    ttl,
+		states: make(map[string]time.Time),
+	}
+}
+
+// Put implements StateStore. It also sweeps out any previously stored states
+// that have expired, so flows that are started and then abandoned (a closed
+// tab, or Begin being hammered by an attacker) don't accumulate forever.
+func (s *MemoryStateStore) Put(w http.ResponseWriter, r *http.Request, state string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, expiry := range s.states {
+		if now.After(expiry) {
+			delete(s.states, k)
+		}
+	}
+
+	s.states[state] = now.Add(s.ttl)
+	return nil
+}
+
+// Verify implements StateStore.
+func (s *MemoryStateStore) Verify(w http.ResponseWriter, r *http.Request, state string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiry, ok := s.states[state]
+	delete(s.states, state)
+	if !ok {
+		return false, nil
+	}
+	return time.Now().Before(expiry), nil
+}
+
+const defaultStateCookieName = "_shopify_oauth_state"
+
+// CookieStateStore is a stateless StateStore: it HMAC-signs the state into a
+// secure, http-only cookie using the app's API secret instead of keeping any
+// server-side record, so it works behind a load balancer without sticky
+// sessions.
+//
+// Because it keeps no server-side record, it cannot guarantee a state is
+// consumed exactly once the way MemoryStateStore can: Verify clears the
+// cookie on success so a second callback replayed through the same browser
+// fails, but a copy of the callback URL made before it is consumed (e.g. via
+// logs or a referrer leak) remains valid until the cookie's MaxAge elapses.
+// Use MemoryStateStore when a server-enforced single-use guarantee matters
+// more than running statelessly.
+type CookieStateStore struct {
+	app        App
+	CookieName string
+	MaxAge     time.Duration
+}
+
+// NewCookieStateStore builds a CookieStateStore for app using the default
+// cookie name and a 10 minute max age.
+func NewCookieStateStore(app App) *CookieStateStore {
+	return &CookieStateStore{
+		app:        app,
+		CookieName: defaultStateCookieName,
+		MaxAge:     10 * time.Minute,
+	}
+}
+
+// Put implements StateStore.
+func (s *CookieStateStore) Put(w http.ResponseWriter, r *http.Request, state string) error {
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.CookieName,
+		Value:    state + "." + s.sign(state),
+		MaxAge:   int(s.MaxAge.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	})
+	return nil
+}
+
+// Verify implements StateStore. On a successful match it clears the cookie
+// so the same callback cannot be replayed through the same browser.
+func (s *CookieStateStore) Verify(w http.ResponseWriter, r *http.Request, state string) (bool, error) {
+	cookie, err := r.Cookie(s.CookieName)
+	if err != nil {
+		return false, nil
+	}
+
+	expected := state + "." + s.sign(state)
+	if !hmac.Equal([]byte(cookie.Value), []byte(expected)) {
+		return false, nil
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.CookieName,
+		Value:    "",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	})
+	return true, nil
+}
+
+func (s *CookieStateStore) sign(state string) string {
+	mac := hmac.New(sha256.New, []byte(s.app.ApiSecret))
+	mac.Write([]byte(state))
+	return hex.EncodeToString(mac.Sum(nil))
+}
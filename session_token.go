@@ -0,0 +1,164 @@
+package goshopify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// clockSkew is the amount of leeway allowed when checking a session token's
+// exp and nbf claims against the local clock.
+const clockSkew = 5 * time.Second
+
+// SessionClaims are the claims of a Shopify session token, issued by App
+// Bridge and sent by the embedded app frontend as a Bearer token on the
+// Authorization header.
+type SessionClaims struct {
+	Iss  string `json:"iss"`
+	Dest string `json:"dest"`
+	Aud  string `json:"aud"`
+	Sub  string `json:"sub"`
+	Exp  int64  `json:"exp"`
+	Nbf  int64  `json:"nbf"`
+	Iat  int64  `json:"iat"`
+	Jti  string `json:"jti"`
+	Sid  string `json:"sid"`
+}
+
+// ShopDomain returns the shop's myshopify.com domain, extracted from the
+// dest claim.
+func (c SessionClaims) ShopDomain() string {
+	u, err := url.Parse(c.Dest)
+	if err != nil {
+		return c.Dest
+	}
+	if u.Host != "" {
+		return u.Host
+	}
+	return c.Dest
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+// VerifySessionToken parses and verifies a Shopify session token (a compact
+// HS256 JWT). It checks the signature against app.ApiSecret, and validates
+// the aud, iss/dest, exp and nbf claims.
+func (app App) VerifySessionToken(tokenString string) (*SessionClaims, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("session token is not a well-formed JWT")
+	}
+	headerB64, payloadB64, sigB64 := parts[0], parts[1], parts[2]
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(headerB64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding header: %w", err)
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("parsing header: %w", err)
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(sigB64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding signature: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(app.ApiSecret))
+	mac.Write([]byte(headerB64 + "." + payloadB64))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, errors.New("session token signature is invalid")
+	}
+
+	payloadJSON, err := base64.RawURLEncoding.DecodeString(payloadB64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding payload: %w", err)
+	}
+	var claims SessionClaims
+	if err := json.Unmarshal(payloadJSON, &claims); err != nil {
+		return nil, fmt.Errorf("parsing payload: %w", err)
+	}
+
+	if claims.Aud != app.ApiKey {
+		return nil, errors.New("session token aud does not match app api key")
+	}
+
+	issHost, err := hostOf(claims.Iss)
+	if err != nil {
+		return nil, fmt.Errorf("parsing iss: %w", err)
+	}
+	destHost, err := hostOf(claims.Dest)
+	if err != nil {
+		return nil, fmt.Errorf("parsing dest: %w", err)
+	}
+	if issHost == "" || issHost != destHost {
+		return nil, errors.New("session token iss and dest do not share a host")
+	}
+
+	now := time.Now()
+	if now.After(time.Unix(claims.Exp, 0).Add(clockSkew)) {
+		return nil, errors.New("session token is expired")
+	}
+	if now.Before(time.Unix(claims.Nbf, 0).Add(-clockSkew)) {
+		return nil, errors.New("session token is not yet valid")
+	}
+
+	return &claims, nil
+}
+
+func hostOf(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return u.Host, nil
+}
+
+const sessionClaimsContextKey contextKey = "goshopify.sessionClaims"
+
+// SessionClaimsFromContext returns the SessionClaims stashed by
+// SessionTokenMiddleware, if any.
+func SessionClaimsFromContext(ctx context.Context) (*SessionClaims, bool) {
+	claims, ok := ctx.Value(sessionClaimsContextKey).(*SessionClaims)
+	return claims, ok
+}
+
+// SessionTokenMiddleware verifies the session token carried in the
+// Authorization: Bearer header of incoming requests, rejecting requests
+// with a missing or invalid token with 401 before the wrapped handler runs.
+// On success it stashes the parsed SessionClaims in the request context,
+// retrievable with SessionClaimsFromContext.
+func SessionTokenMiddleware(app App) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			const prefix = "Bearer "
+			if !strings.HasPrefix(authHeader, prefix) {
+				http.Error(w, "missing bearer session token", http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := app.VerifySessionToken(strings.TrimPrefix(authHeader, prefix))
+			if err != nil {
+				http.Error(w, "session token verification failed: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), sessionClaimsContextKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package goshopify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// Verifier holds one or more API secrets and performs HMAC verification
+// against all of them. This allows apps to rotate their API secret without
+// downtime: configure the new secret as primary and keep the old one until
+// every client has moved over.
+//
+// Every comparison is done with hmac.Equal against each secret in turn, so
+// verification remains constant-time per secret regardless of how many
+// secrets are configured.
+//
+// Rotation is only reachable by constructing a Verifier directly and
+// calling its methods. App's own Verify* methods, WebhookMiddleware,
+// AppProxyMiddleware, OAuthFlow and App.VerifySessionToken all verify
+// against the single App.ApiSecret and do not consult a Verifier; there is
+// no rotation support through those entry points.
+type Verifier struct {
+	// Secrets is tried in order. The first entry is typically the current
+	// API secret; any further entries are previous secrets kept around
+	// during rotation.
+	Secrets []string
+}
+
+// NewVerifier builds a Verifier from one or more secrets.
+func NewVerifier(secrets ...string) Verifier {
+	return Verifier{Secrets: secrets}
+}
+
+// VerifyMessage verifies a message against a message HMAC, trying each
+// configured secret. It returns whether the message verified and, if so,
+// the index into Secrets that matched (or -1 if none did), so callers can
+// log or alert when a non-primary (rotated out) secret is still in use
+// without logging the secret itself.
+func (v Verifier) VerifyMessage(message, messageMAC string) (bool, int) {
+	// shopify HMAC is in hex so it needs to be decoded
+	actualMac, _ := hex.DecodeString(messageMAC)
+
+	for i, secret := range v.Secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(message))
+		if hmac.Equal(actualMac, mac.Sum(nil)) {
+			return true, i
+		}
+	}
+	return false, -1
+}
+
+// VerifyAuthorizationURL verifies URL callback parameters, trying each
+// configured secret. It returns whether the URL verified and the index into
+// Secrets that matched (or -1 if none did).
+func (v Verifier) VerifyAuthorizationURL(u *url.URL) (bool, int, error) {
+	q := u.Query()
+	messageMAC := q.Get("hmac")
+
+	// Remove hmac and signature and leave the rest of the parameters alone.
+	q.Del("hmac")
+	q.Del("signature")
+
+	message, err := url.QueryUnescape(q.Encode())
+	ok, matched := v.VerifyMessage(message, messageMAC)
+	return ok, matched, err
+}
+
+// VerifyWebhookRequest verifies a webhook http request, sent by Shopify,
+// trying each configured secret. The body of the request is still readable
+// after invoking the method. It returns whether the request verified and
+// the index into Secrets that matched (or -1 if none did).
+func (v Verifier) VerifyWebhookRequest(httpRequest *http.Request) (bool, int) {
+	shopifySha256 := httpRequest.Header.Get(shopifyChecksumHeader)
+	actualMac := []byte(shopifySha256)
+
+	requestBody, _ := ioutil.ReadAll(httpRequest.Body)
+	httpRequest.Body = ioutil.NopCloser(bytes.NewBuffer(requestBody))
+
+	for i, secret := range v.Secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(requestBody)
+		expectedMac := []byte(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+		if hmac.Equal(actualMac, expectedMac) {
+			return true, i
+		}
+	}
+	return false, -1
+}
+
+// VerifyWebhookRequestVerbose verifies a webhook http request, sent by
+// Shopify, trying each configured secret. The body of the request is still
+// readable after invoking the method. This method has more verbose error
+// output which is useful for debugging. It returns the index into Secrets
+// that matched (or -1 if none did).
+func (v Verifier) VerifyWebhookRequestVerbose(httpRequest *http.Request) (bool, int, error) {
+	if len(v.Secrets) == 0 {
+		return false, -1, errors.New("no secrets configured")
+	}
+
+	shopifySha256 := httpRequest.Header.Get(shopifyChecksumHeader)
+	if shopifySha256 == "" {
+		return false, -1, fmt.Errorf("header %s not set", shopifyChecksumHeader)
+	}
+
+	decodedReceivedHMAC, err := base64.StdEncoding.DecodeString(shopifySha256)
+	if err != nil {
+		return false, -1, err
+	}
+	if len(decodedReceivedHMAC) != 32 {
+		return false, -1, fmt.Errorf("received HMAC is not of length 32, it is of length %d", len(decodedReceivedHMAC))
+	}
+
+	requestBody, err := ioutil.ReadAll(httpRequest.Body)
+	if err != nil {
+		return false, -1, err
+	}
+	httpRequest.Body = ioutil.NopCloser(bytes.NewBuffer(requestBody))
+	if len(requestBody) == 0 {
+		return false, -1, errors.New("request body is empty")
+	}
+
+	for i, secret := range v.Secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(requestBody)
+		computedHMAC := mac.Sum(nil)
+		if hmac.Equal(decodedReceivedHMAC, computedHMAC) {
+			return true, i, nil
+		}
+	}
+
+	return false, -1, fmt.Errorf("received HMAC %x does not match any configured secret", decodedReceivedHMAC)
+}
+
+// VerifySignature verifies an app proxy request, sent by Shopify, trying
+// each configured secret. It returns whether the request verified and the
+// index into Secrets that matched (or -1 if none did).
+func (v Verifier) VerifySignature(u *url.URL) (bool, int) {
+	val := u.Query()
+	sig := val.Get("signature")
+	val.Del("signature")
+
+	joined := EncodeProxyParams(val)
+
+	for i, secret := range v.Secrets {
+		if hmacSHA256([]byte(secret), []byte(joined), []byte(sig)) {
+			return true, i
+		}
+	}
+	return false, -1
+}
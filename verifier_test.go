@@ -0,0 +1,101 @@
+package goshopify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerifierVerifyMessageRotation(t *testing.T) {
+	v := NewVerifier("current-secret", "previous-secret")
+
+	message := "shop=example.myshopify.com"
+	mac := hmac.New(sha256.New, []byte("previous-secret"))
+	mac.Write([]byte(message))
+	messageMAC := hex.EncodeToString(mac.Sum(nil))
+
+	ok, idx := v.VerifyMessage(message, messageMAC)
+	if !ok {
+		t.Fatal("expected message signed with a previous secret to verify")
+	}
+	if idx != 1 {
+		t.Fatalf("expected match on secret index 1, got %d", idx)
+	}
+}
+
+func TestVerifierVerifyMessageNoMatch(t *testing.T) {
+	v := NewVerifier("current-secret", "previous-secret")
+
+	message := "shop=example.myshopify.com"
+	mac := hmac.New(sha256.New, []byte("unrelated-secret"))
+	mac.Write([]byte(message))
+	messageMAC := hex.EncodeToString(mac.Sum(nil))
+
+	ok, idx := v.VerifyMessage(message, messageMAC)
+	if ok {
+		t.Fatal("expected message signed with an unconfigured secret not to verify")
+	}
+	if idx != -1 {
+		t.Fatalf("expected no match to report index -1, got %d", idx)
+	}
+}
+
+func TestVerifierVerifyWebhookRequestRotation(t *testing.T) {
+	v := NewVerifier("current-secret", "previous-secret")
+
+	body := []byte(`{"id":1}`)
+	mac := hmac.New(sha256.New, []byte("previous-secret"))
+	mac.Write(body)
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body))
+	req.Header.Set(shopifyChecksumHeader, signature)
+
+	ok, idx := v.VerifyWebhookRequest(req)
+	if !ok {
+		t.Fatal("expected webhook signed with a previous secret to verify")
+	}
+	if idx != 1 {
+		t.Fatalf("expected match on secret index 1, got %d", idx)
+	}
+
+	// The body must still be readable by the wrapped handler.
+	replayed, err := readAll(req)
+	if err != nil {
+		t.Fatalf("unexpected error reading restored body: %v", err)
+	}
+	if !bytes.Equal(replayed, body) {
+		t.Fatalf("expected request body to be restored, got %q", replayed)
+	}
+}
+
+func TestVerifierVerifyWebhookRequestNoMatch(t *testing.T) {
+	v := NewVerifier("current-secret", "previous-secret")
+
+	body := []byte(`{"id":1}`)
+	mac := hmac.New(sha256.New, []byte("unrelated-secret"))
+	mac.Write(body)
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body))
+	req.Header.Set(shopifyChecksumHeader, signature)
+
+	ok, idx := v.VerifyWebhookRequest(req)
+	if ok {
+		t.Fatal("expected webhook signed with an unconfigured secret not to verify")
+	}
+	if idx != -1 {
+		t.Fatalf("expected no match to report index -1, got %d", idx)
+	}
+}
+
+func readAll(req *http.Request) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	_, err := buf.ReadFrom(req.Body)
+	return buf.Bytes(), err
+}